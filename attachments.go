@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// attachmentUpload holds an attachment received over HTTP, prior to it being
+// delivered to the Maildir.
+type attachmentUpload struct {
+	Filename string
+	Data     []byte
+}
+
+// readAttachmentUpload reads an uploaded file's contents out of a multipart
+// form file header.
+func readAttachmentUpload(fh *multipart.FileHeader) (attachmentUpload, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return attachmentUpload{}, fmt.Errorf("unable to open upload: %s: %s",
+			fh.Filename, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return attachmentUpload{}, fmt.Errorf("unable to read upload: %s: %s",
+			fh.Filename, err)
+	}
+
+	return attachmentUpload{Filename: fh.Filename, Data: data}, nil
+}
+
+// attachmentFilenameRe restricts attachment filenames the same way rageshake
+// does: a safe basename with one of a small set of allowed extensions.
+var attachmentFilenameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+\.(jpg|png|txt)$`)
+
+// commentIDRe restricts comment IDs used as an attachment directory
+// component to a safe token, so a crafted comment (e.g. an ID of
+// "../../../../var/www/other-site") can't escape htmlDir.
+var commentIDRe = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// parseMailMultipart reads a multipart mail body, decoding the comment JSON
+// part and streaming any remaining parts that have a filename to disk as
+// attachments. Parts without a filename are skipped.
+//
+// The JSON part must come first so we know the comment's ID (and therefore
+// its attachment directory) before we see any attachment parts.
+func parseMailMultipart(body io.Reader, boundary, htmlDir string) (commentJSON, []string, error) {
+	var cj commentJSON
+
+	if boundary == "" {
+		return cj, nil, fmt.Errorf("multipart message missing boundary")
+	}
+
+	mr := multipart.NewReader(body, boundary)
+
+	part, err := mr.NextPart()
+	if err != nil {
+		return cj, nil, fmt.Errorf("unable to read JSON part: %s", err)
+	}
+
+	partBody, err := ioutil.ReadAll(part)
+	if err != nil {
+		return cj, nil, fmt.Errorf("unable to read JSON part: %s", err)
+	}
+
+	cj, err = decodeCommentJSON(partBody)
+	if err != nil {
+		return cj, nil, err
+	}
+
+	id := cj.MessageAttributes.ID["Value"]
+
+	var attachments []string
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return cj, nil, fmt.Errorf("unable to read attachment part: %s", err)
+		}
+
+		filename := part.FileName()
+		if filename == "" {
+			continue
+		}
+
+		if err := saveAttachment(htmlDir, id, filename, part); err != nil {
+			return cj, nil, err
+		}
+
+		attachments = append(attachments, filename)
+	}
+
+	return cj, attachments, nil
+}
+
+// isImageAttachment reports whether an attachment filename should be
+// rendered as an image rather than a plain link.
+func isImageAttachment(filename string) bool {
+	return strings.HasSuffix(filename, ".jpg") || strings.HasSuffix(filename, ".png")
+}
+
+// attachmentDir returns the directory attachments for a comment are stored
+// under.
+func attachmentDir(htmlDir, commentID string) string {
+	return filepath.Join(htmlDir, "attachments", commentID)
+}
+
+// isValidCommentID reports whether a comment ID is safe to use as a single
+// path component. It's stricter than commentIDRe alone since "." is an
+// allowed character but ".." is not a safe path segment.
+func isValidCommentID(commentID string) bool {
+	return commentIDRe.MatchString(commentID) && !strings.Contains(commentID, "..")
+}
+
+// saveAttachment validates an attachment's filename and comment ID and
+// streams the attachment to a per-comment subdirectory under htmlDir.
+func saveAttachment(htmlDir, commentID, filename string, r io.Reader) error {
+	if !attachmentFilenameRe.MatchString(filename) {
+		return fmt.Errorf("invalid attachment filename: %s", filename)
+	}
+
+	if !isValidCommentID(commentID) {
+		return fmt.Errorf("invalid comment ID: %s", commentID)
+	}
+
+	dir := attachmentDir(htmlDir, commentID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("unable to create attachment directory: %s: %s", dir, err)
+	}
+
+	path := filepath.Join(dir, filename)
+
+	fh, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create: %s: %s", path, err)
+	}
+
+	if _, err := io.Copy(fh, r); err != nil {
+		_ = fh.Close()
+		return fmt.Errorf("unable to write: %s: %s", path, err)
+	}
+
+	if err := fh.Close(); err != nil {
+		return fmt.Errorf("problem closing file: %s: %s", path, err)
+	}
+
+	return nil
+}
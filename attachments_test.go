@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestIsValidCommentID(t *testing.T) {
+	valid := []string{"msg1", "1700000000000.1234", "a.b-c_d"}
+	for _, id := range valid {
+		if !isValidCommentID(id) {
+			t.Errorf("expected %q to be a valid comment ID", id)
+		}
+	}
+
+	invalid := []string{
+		"../../../../var/www/other-site",
+		"..",
+		"foo/bar",
+		"foo/../bar",
+		"",
+	}
+	for _, id := range invalid {
+		if isValidCommentID(id) {
+			t.Errorf("expected %q to be rejected as a comment ID", id)
+		}
+	}
+}
+
+func TestSaveAttachmentRejectsPathTraversalCommentID(t *testing.T) {
+	htmlDir := t.TempDir()
+
+	err := saveAttachment(htmlDir, "../../../../etc", "a.png", nil)
+	if err == nil {
+		t.Fatal("expected an error for a path-traversing comment ID, got nil")
+	}
+}
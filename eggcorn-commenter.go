@@ -5,41 +5,69 @@
 // in a JSON payload in the body of the mail. It parses the messages and the
 // JSON in each, and outputs HTML files based on the page name found in each
 // comment.
+//
+// It can also run as an HTTP server (see -listen) that accepts comments
+// directly, in which case it drops each one into the Maildir as a new message
+// and regenerates the affected page's HTML.
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
-	"html/template"
 	"io/ioutil"
+	"mime"
 	"net"
 	"net/mail"
-	"net/url"
 	"os"
-	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/emersion/go-maildir"
 )
 
 // Args holds command line arguments.
 type Args struct {
 	Maildir string
 	HTMLDir string
+	Listen  string
+	Format  string
+	Watch   bool
 }
 
 // Comment holds information about a single comment.
 type Comment struct {
-	Name      string
-	Email     string
-	Text      string
-	URL       string
-	IP        net.IP
-	UserAgent string
-	Time      time.Time
-	ID        string
+	Name        string
+	Email       string
+	Text        string
+	URL         string
+	IP          net.IP
+	UserAgent   string
+	Time        time.Time
+	ID          string
+	Attachments []string
+}
+
+// messageAttributesJSON is the shape of each field in the JSON payload found
+// in the body of a comment mail. Real mail attributes are wrapped this way by
+// the SNS/SES pipeline that eggcorn uses to deliver comments; we keep the same
+// shape when we encode a comment to drop it into the Maildir ourselves (see
+// encodeCommentJSON) so parseMail can read it back unchanged.
+type messageAttributesJSON struct {
+	Name      map[string]string
+	Email     map[string]string
+	Text      map[string]string
+	URL       map[string]string
+	IP        map[string]string
+	UserAgent map[string]string
+	Time      map[string]string
+	ID        map[string]string
+}
+
+// commentJSON is the JSON payload found in the body of a comment mail.
+type commentJSON struct {
+	MessageAttributes messageAttributesJSON
 }
 
 // ByTime implements sort.Interface for []*Comment based on the Time field.
@@ -62,7 +90,29 @@ func main() {
 		os.Exit(1)
 	}
 
-	comments, err := parseMails(args.Maildir)
+	if len(args.Listen) > 0 {
+		if err := runServer(args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if args.Watch {
+		if err := runWatch(args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	renderers, err := renderersFromFormat(args.Format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	comments, err := parseMails(args.Maildir, args.HTMLDir)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -70,10 +120,8 @@ func main() {
 
 	for rawURL, pageComments := range comments {
 		sort.Sort(ByTime(pageComments))
-		err := writeHTML(args.HTMLDir, rawURL, pageComments)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Unable to write HTML for page: %s: %s\n", rawURL,
-				err)
+		if err := renderPage(renderers, args.HTMLDir, rawURL, pageComments); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to render page: %s: %s\n", rawURL, err)
 			os.Exit(1)
 		}
 	}
@@ -82,6 +130,9 @@ func main() {
 func getArgs() (*Args, error) {
 	maildir := flag.String("maildir", "", "Path to Maildir containing comment emails.")
 	htmlDir := flag.String("html-dir", "", "Path to directory to write HTML files.")
+	listen := flag.String("listen", "", "If given, run an HTTP server on this address (e.g. :8080) to accept new comments instead of processing the Maildir once.")
+	format := flag.String("format", "html", "Comma-separated list of output formats to render: html, atom, rss, json.")
+	watch := flag.Bool("watch", false, "Watch the Maildir's new directory and regenerate affected pages as messages arrive, instead of running once.")
 
 	flag.Parse()
 
@@ -96,79 +147,14 @@ func getArgs() (*Args, error) {
 	return &Args{
 		Maildir: *maildir,
 		HTMLDir: *htmlDir,
+		Listen:  *listen,
+		Format:  *format,
+		Watch:   *watch,
 	}, nil
 }
 
-// I recursively descend the Maildir and process all files as if they are mails.
-//
-// Yes, we should only really need to look in the cur (and maybe new)
-// directories.
-//
-// Return Comments keyed by the page URL that the comment is on.
-func parseMails(maildir string) (map[string][]*Comment, error) {
-	dh, err := os.Open(maildir)
-	if err != nil {
-		return nil, err
-	}
-
-	names, err := dh.Readdirnames(0)
-	if err != nil {
-		_ = dh.Close()
-		return nil, fmt.Errorf("error reading dir names: %s", err)
-	}
-
-	if err := dh.Close(); err != nil {
-		return nil, fmt.Errorf("error closing: %s: %s", maildir, err)
-	}
-
-	comments := map[string][]*Comment{}
-
-	for _, filename := range names {
-		if filename == "." || filename == ".." {
-			continue
-		}
-
-		path := filepath.Join(maildir, filename)
-
-		fi, err := os.Stat(path)
-		if err != nil {
-			return nil, fmt.Errorf("stat: %s: %s", path, err)
-		}
-
-		if fi.IsDir() {
-			dirComments, err := parseMails(path)
-			if err != nil {
-				return nil, err
-			}
-
-			for k, v := range dirComments {
-				_, exists := comments[k]
-				if !exists {
-					comments[k] = []*Comment{}
-				}
-				comments[k] = append(comments[k], v...)
-			}
-
-			continue
-		}
-
-		comment, err := parseMail(path)
-		if err != nil {
-			return nil, err
-		}
-
-		_, exists := comments[comment.URL]
-		if !exists {
-			comments[comment.URL] = []*Comment{}
-		}
-		comments[comment.URL] = append(comments[comment.URL], comment)
-	}
-
-	return comments, nil
-}
-
-func parseMail(path string) (*Comment, error) {
-	fh, err := os.Open(path)
+func parseMail(msg *maildir.Message, htmlDir string) (*Comment, error) {
+	fh, err := msg.Open()
 	if err != nil {
 		return nil, err
 	}
@@ -176,39 +162,35 @@ func parseMail(path string) (*Comment, error) {
 	defer func() {
 		err := fh.Close()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "close error: %s: %s\n", path, err)
+			fmt.Fprintf(os.Stderr, "close error: %s: %s\n", msg.Filename(), err)
 		}
 	}()
 
 	message, err := mail.ReadMessage(fh)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse mail: %s: %s", path, err)
+		return nil, fmt.Errorf("unable to parse mail: %s: %s", msg.Filename(), err)
 	}
 
-	body, err := ioutil.ReadAll(message.Body)
-	if err != nil {
-		return nil, fmt.Errorf("unable to read body: %s", err)
-	}
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
 
-	type messageAttributesJSON struct {
-		Name      map[string]string
-		Email     map[string]string
-		Text      map[string]string
-		URL       map[string]string
-		IP        map[string]string
-		UserAgent map[string]string
-		Time      map[string]string
-		ID        map[string]string
-	}
-
-	type commentJSON struct {
-		MessageAttributes messageAttributesJSON
-	}
+	var cj commentJSON
+	var attachments []string
 
-	cj := commentJSON{}
+	if err == nil && strings.HasPrefix(mediaType, "multipart/") {
+		cj, attachments, err = parseMailMultipart(message.Body, params["boundary"], htmlDir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", msg.Filename(), err)
+		}
+	} else {
+		body, err := ioutil.ReadAll(message.Body)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read body: %s", err)
+		}
 
-	if err := json.Unmarshal(body, &cj); err != nil {
-		return nil, fmt.Errorf("unable to decode JSON: %s", err)
+		cj, err = decodeCommentJSON(body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", msg.Filename(), err)
+		}
 	}
 
 	ip := net.ParseIP(cj.MessageAttributes.IP["Value"])
@@ -231,14 +213,15 @@ func parseMail(path string) (*Comment, error) {
 	// fields are here. For one thing this will help recognize if there is a
 	// mistake in decoding.
 	c := &Comment{
-		Name:      cj.MessageAttributes.Name["Value"],
-		Email:     cj.MessageAttributes.Email["Value"],
-		Text:      cj.MessageAttributes.Text["Value"],
-		URL:       cj.MessageAttributes.URL["Value"],
-		IP:        ip,
-		UserAgent: cj.MessageAttributes.UserAgent["Value"],
-		Time:      t,
-		ID:        cj.MessageAttributes.ID["Value"],
+		Name:        cj.MessageAttributes.Name["Value"],
+		Email:       cj.MessageAttributes.Email["Value"],
+		Text:        cj.MessageAttributes.Text["Value"],
+		URL:         cj.MessageAttributes.URL["Value"],
+		IP:          ip,
+		UserAgent:   cj.MessageAttributes.UserAgent["Value"],
+		Time:        t,
+		ID:          cj.MessageAttributes.ID["Value"],
+		Attachments: attachments,
 	}
 
 	if err := c.isValid(); err != nil {
@@ -275,70 +258,3 @@ func (c Comment) isValid() error {
 	}
 	return nil
 }
-
-func writeHTML(htmlDir, rawURL string, comments []*Comment) error {
-	// We base the file we write's name on the URL's path. Parse the URL and take
-	// its path.
-
-	u, err := url.Parse(rawURL)
-	if err != nil {
-		return fmt.Errorf("invalid URL: %s: %s", rawURL, err)
-	}
-
-	if len(u.Path) == 0 || len(u.Path) == 1 {
-		return fmt.Errorf("no path found in URL: %s", rawURL)
-	}
-
-	// u.Path should begin with /. Strip that to make the filename.
-	filename := u.Path[1:]
-
-	// There should be no more / characters.
-	if idx := strings.Index(filename, "/"); idx != -1 {
-		return fmt.Errorf("unexpected path, too many '/' characters: %s", rawURL)
-	}
-
-	// Build the path to the file we're going to write.
-	path := filepath.Join(htmlDir, filename)
-
-	htmlFragment := `
-<h2>Comments</h2>
-{{range .Comments}}
-<div class="comment">
-	<div class="comment-name">{{.Name}}</div>
-	<time>{{.Time}}</time>
-	<div class="comment-text">
-		{{.Text}}
-	</div>
-</div>
-{{end}}
-`
-
-	t, err := template.New("comments").Parse(htmlFragment)
-	if err != nil {
-		return fmt.Errorf("unable to parse template: %s", err)
-	}
-
-	data := struct {
-		Comments []*Comment
-	}{
-		Comments: comments,
-	}
-
-	fh, err := os.Create(path)
-	if err != nil {
-		return err
-	}
-
-	if err := t.Execute(fh, data); err != nil {
-		_ = fh.Close()
-		return fmt.Errorf("unable to execute template: %s", err)
-	}
-
-	if err := fh.Close(); err != nil {
-		return fmt.Errorf("problem closing file: %s", err)
-	}
-
-	fmt.Printf("Wrote %s (%d comments)\n", path, len(comments))
-
-	return nil
-}
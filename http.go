@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/textproto"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/emersion/go-maildir"
+)
+
+// runServer starts an HTTP server that accepts new comments and persists
+// them, instead of processing the Maildir once and exiting.
+func runServer(args *Args) error {
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		handleComment(w, r, args)
+	})
+
+	fmt.Printf("Listening on %s\n", args.Listen)
+
+	return http.ListenAndServe(args.Listen, nil)
+}
+
+// handleComment accepts a new comment over HTTP, persists it, and
+// regenerates the HTML for the page it is on.
+func handleComment(w http.ResponseWriter, r *http.Request, args *Args) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	c, attachments, err := commentFromRequest(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to parse comment: %s", err),
+			http.StatusBadRequest)
+		return
+	}
+
+	if err := c.isValid(); err != nil {
+		http.Error(w, fmt.Sprintf("invalid comment: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := deliverToMaildir(args.Maildir, c, attachments); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to deliver comment to maildir: %s\n", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := regeneratePage(args, c.URL); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to regenerate page: %s: %s\n", c.URL, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// commentFromRequest builds a Comment from an HTTP request, supporting JSON,
+// form, and multipart form bodies following the pattern used by Micropub
+// endpoints.
+func commentFromRequest(r *http.Request) (*Comment, []attachmentUpload, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Content-Type: %s", err)
+	}
+
+	var name, email, text, rawURL string
+	var attachments []attachmentUpload
+
+	switch mediaType {
+	case "application/json":
+		var body struct {
+			Name  string
+			Email string
+			Text  string
+			URL   string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return nil, nil, fmt.Errorf("unable to decode JSON: %s", err)
+		}
+		name, email, text, rawURL = body.Name, body.Email, body.Text, body.URL
+
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(10 << 20); err != nil {
+			return nil, nil, fmt.Errorf("unable to parse multipart form: %s", err)
+		}
+		name = r.FormValue("name")
+		email = r.FormValue("email")
+		text = r.FormValue("text")
+		rawURL = r.FormValue("url")
+
+		if r.MultipartForm != nil {
+			for _, headers := range r.MultipartForm.File {
+				for _, fh := range headers {
+					a, err := readAttachmentUpload(fh)
+					if err != nil {
+						return nil, nil, err
+					}
+					if !attachmentFilenameRe.MatchString(a.Filename) {
+						return nil, nil, fmt.Errorf("invalid attachment filename: %s", a.Filename)
+					}
+					attachments = append(attachments, a)
+				}
+			}
+		}
+
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return nil, nil, fmt.Errorf("unable to parse form: %s", err)
+		}
+		name = r.FormValue("name")
+		email = r.FormValue("email")
+		text = r.FormValue("text")
+		rawURL = r.FormValue("url")
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported Content-Type: %s", mediaType)
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, nil, fmt.Errorf("unable to determine IP from: %s", r.RemoteAddr)
+	}
+
+	c := &Comment{
+		Name:      name,
+		Email:     email,
+		Text:      text,
+		URL:       rawURL,
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+		Time:      time.Now(),
+		ID:        fmt.Sprintf("%d.%d", time.Now().UnixNano(), os.Getpid()),
+	}
+
+	return c, attachments, nil
+}
+
+// deliverToMaildir writes a comment to the Maildir as a new message, encoded
+// the same way parseMail expects to read it back. If the comment has
+// attachments, the message is written as multipart/mixed, matching what
+// parseMailMultipart parses on the next run.
+//
+// Delivery goes through maildir.NewDelivery so the message is written to tmp
+// and atomically moved into new, same as any other Maildir-delivering agent,
+// and so parseMailsDiff's cur-only Walk picks it up on its next run.
+func deliverToMaildir(maildirPath string, c *Comment, attachments []attachmentUpload) error {
+	jsonBody, err := json.Marshal(encodeCommentJSON(c))
+	if err != nil {
+		return fmt.Errorf("unable to encode comment: %s", err)
+	}
+
+	var header, body bytes.Buffer
+
+	if len(attachments) == 0 {
+		header.WriteString("Subject: eggcorn comment\r\n\r\n")
+		body.Write(jsonBody)
+	} else {
+		mw := multipart.NewWriter(&body)
+
+		jsonPart, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"application/json"},
+		})
+		if err != nil {
+			return fmt.Errorf("unable to create JSON part: %s", err)
+		}
+		if _, err := jsonPart.Write(jsonBody); err != nil {
+			return fmt.Errorf("unable to write JSON part: %s", err)
+		}
+
+		for _, a := range attachments {
+			fw, err := mw.CreateFormFile("attachment", a.Filename)
+			if err != nil {
+				return fmt.Errorf("unable to create attachment part: %s: %s", a.Filename, err)
+			}
+			if _, err := fw.Write(a.Data); err != nil {
+				return fmt.Errorf("unable to write attachment part: %s: %s", a.Filename, err)
+			}
+		}
+
+		if err := mw.Close(); err != nil {
+			return fmt.Errorf("unable to close multipart writer: %s", err)
+		}
+
+		fmt.Fprintf(&header, "Subject: eggcorn comment\r\nContent-Type: multipart/mixed; boundary=%s\r\n\r\n",
+			mw.Boundary())
+	}
+
+	delivery, err := maildir.NewDelivery(maildirPath)
+	if err != nil {
+		return fmt.Errorf("unable to start delivery: %s: %s", maildirPath, err)
+	}
+
+	msg := append(header.Bytes(), body.Bytes()...)
+
+	if _, err := delivery.Write(msg); err != nil {
+		_ = delivery.Abort()
+		return fmt.Errorf("unable to write: %s: %s", maildirPath, err)
+	}
+
+	if err := delivery.Close(); err != nil {
+		return fmt.Errorf("unable to complete delivery: %s: %s", maildirPath, err)
+	}
+
+	return nil
+}
+
+// encodeCommentJSON converts a Comment to the JSON shape parseMail expects in
+// a mail body.
+func encodeCommentJSON(c *Comment) commentJSON {
+	unixtimeMS := strconv.FormatInt(c.Time.UnixNano()/int64(time.Millisecond), 10)
+
+	return commentJSON{
+		MessageAttributes: messageAttributesJSON{
+			Name:      map[string]string{"Value": c.Name},
+			Email:     map[string]string{"Value": c.Email},
+			Text:      map[string]string{"Value": c.Text},
+			URL:       map[string]string{"Value": c.URL},
+			IP:        map[string]string{"Value": c.IP.String()},
+			UserAgent: map[string]string{"Value": c.UserAgent},
+			Time:      map[string]string{"Value": unixtimeMS},
+			ID:        map[string]string{"Value": c.ID},
+		},
+	}
+}
+
+// regeneratePage reprocesses the Maildir and rewrites the configured output
+// formats for a single page. It's used to keep the site up to date as
+// comments arrive over HTTP, without requiring a full batch run.
+//
+// It holds regenMu for its duration: net/http runs each request on its own
+// goroutine, and two comments landing close together must not race on the
+// cache index or on the same page's output files.
+func regeneratePage(args *Args, rawURL string) error {
+	regenMu.Lock()
+	defer regenMu.Unlock()
+
+	renderers, err := renderersFromFormat(args.Format)
+	if err != nil {
+		return err
+	}
+
+	comments, err := parseMails(args.Maildir, args.HTMLDir)
+	if err != nil {
+		return err
+	}
+
+	pageComments := comments[rawURL]
+	sort.Sort(ByTime(pageComments))
+
+	return renderPage(renderers, args.HTMLDir, rawURL, pageComments)
+}
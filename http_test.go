@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCommentFromRequestRejectsBadAttachmentFilename(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	for field, value := range map[string]string{
+		"name":  "Alice",
+		"email": "alice@example.com",
+		"text":  "hi",
+		"url":   "http://example.com/post1",
+	} {
+		if err := mw.WriteField(field, value); err != nil {
+			t.Fatalf("unable to write field %s: %s", field, err)
+		}
+	}
+
+	fw, err := mw.CreateFormFile("attachment", "../../etc/passwd")
+	if err != nil {
+		t.Fatalf("unable to create form file: %s", err)
+	}
+	if _, err := fw.Write([]byte("data")); err != nil {
+		t.Fatalf("unable to write form file: %s", err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("unable to close multipart writer: %s", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	_, _, err = commentFromRequest(req)
+	if err == nil {
+		t.Fatal("expected an error for a disallowed attachment filename, got nil")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// indexFilename is the name of the cache index file we keep alongside a
+// Maildir's tmp/new/cur directories. It's not itself a message, so the
+// maildir package's Walk (which only looks in cur) never touches it.
+const indexFilename = ".eggcorn-commenter-index.json"
+
+// cacheEntry is a cached, already-parsed comment, keyed by Maildir message
+// key. It's valid only as long as ModTime still matches the message file.
+type cacheEntry struct {
+	ModTime int64
+	Comment *Comment
+}
+
+// cacheIndex caches parsed comments by Maildir key so that re-running over
+// an unchanged Maildir doesn't need to reparse every message.
+type cacheIndex map[string]cacheEntry
+
+func loadCacheIndex(maildirPath string) (cacheIndex, error) {
+	data, err := ioutil.ReadFile(filepath.Join(maildirPath, indexFilename))
+	if os.IsNotExist(err) {
+		return cacheIndex{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cache index: %s", err)
+	}
+
+	idx := cacheIndex{}
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("unable to decode cache index: %s", err)
+	}
+
+	return idx, nil
+}
+
+func saveCacheIndex(maildirPath string, idx cacheIndex) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return fmt.Errorf("unable to encode cache index: %s", err)
+	}
+
+	path := filepath.Join(maildirPath, indexFilename)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("unable to write cache index: %s: %s", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// decodeCommentJSON decodes a comment JSON payload, reporting the line and
+// character a syntax or type error occurred at. This matters because a
+// malformed message can otherwise sit in the Maildir for weeks with nothing
+// but "unexpected end of JSON input" to go on.
+func decodeCommentJSON(body []byte) (commentJSON, error) {
+	var cj commentJSON
+
+	err := json.Unmarshal(body, &cj)
+	if err == nil {
+		return cj, nil
+	}
+
+	var offset int64
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		return cj, fmt.Errorf("unable to decode JSON: %s", err)
+	}
+
+	line, char, snippet := jsonOffsetLocation(body, offset)
+
+	return cj, fmt.Errorf("invalid JSON at line %d char %d (offset %d): %s\n%s",
+		line, char, offset, err, snippet)
+}
+
+// jsonOffsetLocation converts a byte offset into a 1-based line and character
+// position, along with the full line the offset falls on.
+func jsonOffsetLocation(body []byte, offset int64) (line, char int, snippet string) {
+	line = 1
+	char = 1
+	lineStart := 0
+
+	for i, b := range body {
+		if int64(i) >= offset {
+			break
+		}
+		if b == '\n' {
+			line++
+			char = 1
+			lineStart = i + 1
+		} else {
+			char++
+		}
+	}
+
+	lineEnd := bytes.IndexByte(body[lineStart:], '\n')
+	if lineEnd == -1 {
+		snippet = string(body[lineStart:])
+	} else {
+		snippet = string(body[lineStart : lineStart+lineEnd])
+	}
+
+	return line, char, snippet
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJSONOffsetLocation(t *testing.T) {
+	body := []byte("line one\nline two\nline three")
+
+	cases := []struct {
+		offset      int64
+		line, char  int
+		wantSnippet string
+	}{
+		{0, 1, 1, "line one"},
+		{4, 1, 5, "line one"},
+		{9, 2, 1, "line two"},
+		{13, 2, 5, "line two"},
+		{18, 3, 1, "line three"},
+		{19, 3, 2, "line three"},
+	}
+
+	for _, c := range cases {
+		line, char, snippet := jsonOffsetLocation(body, c.offset)
+		if line != c.line || char != c.char || snippet != c.wantSnippet {
+			t.Errorf("jsonOffsetLocation(body, %d) = (%d, %d, %q), want (%d, %d, %q)",
+				c.offset, line, char, snippet, c.line, c.char, c.wantSnippet)
+		}
+	}
+}
+
+func TestDecodeCommentJSONReportsLocation(t *testing.T) {
+	body := []byte("{\n  \"MessageAttributes\": invalid\n}")
+
+	_, err := decodeCommentJSON(body)
+	if err == nil {
+		t.Fatal("expected an error for invalid JSON, got nil")
+	}
+	if !strings.Contains(err.Error(), "invalid JSON at line 2 ") {
+		t.Fatalf("expected the error to report line 2, got: %s", err)
+	}
+}
+
+func TestDecodeCommentJSONValid(t *testing.T) {
+	body := []byte(`{"MessageAttributes":{"Name":{"Value":"Alice"}}}`)
+
+	cj, err := decodeCommentJSON(body)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cj.MessageAttributes.Name["Value"] != "Alice" {
+		t.Fatalf("unexpected decoded name: %s", cj.MessageAttributes.Name["Value"])
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/emersion/go-maildir"
+)
+
+// regenMu serializes access to the on-disk cache index and to page
+// regeneration. Without it, two comments arriving close together over HTTP
+// (each handled on its own goroutine) could race on a read-modify-write of
+// the cache index file or on writing the same page's output files. Callers
+// that read or write the cache index, or regenerate pages from it, should
+// hold this for the duration. It is a process-local lock: it does not
+// serialize separate processes working on the same Maildir.
+var regenMu sync.Mutex
+
+// parseMails processes a Maildir's messages into Comments keyed by the page
+// URL the comment is on.
+func parseMails(maildirPath, htmlDir string) (map[string][]*Comment, error) {
+	comments, _, err := parseMailsDiff(maildirPath, htmlDir)
+	return comments, err
+}
+
+// parseMailsDiff is like parseMails, but also reports which page URLs got a
+// new or changed comment on this run, so callers like -watch mode can
+// regenerate only the affected pages.
+//
+// It enumerates messages in cur (after moving any new ones in from new), and
+// caches parsed Comments by Maildir key and file modification time so that
+// re-running over unchanged messages doesn't reparse them.
+//
+// A message that fails to parse is logged and skipped rather than aborting
+// the whole run: go-maildir's Walk stops at the first error its callback
+// returns, and on a live -listen/-watch daemon that would mean one bad
+// message permanently wedges regeneration of every page.
+func parseMailsDiff(maildirPath, htmlDir string) (map[string][]*Comment, map[string]bool, error) {
+	d := maildir.Dir(maildirPath)
+
+	if _, err := d.Unseen(); err != nil {
+		return nil, nil, fmt.Errorf("unable to move new messages: %s: %s", maildirPath, err)
+	}
+
+	idx, err := loadCacheIndex(maildirPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	comments := map[string][]*Comment{}
+	changed := map[string]bool{}
+
+	err = d.Walk(func(msg *maildir.Message) error {
+		fi, err := os.Stat(msg.Filename())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping message: stat: %s: %s\n", msg.Filename(), err)
+			return nil
+		}
+		mtime := fi.ModTime().UnixNano()
+
+		entry, ok := idx[msg.Key()]
+
+		var c *Comment
+		if ok && entry.ModTime == mtime {
+			c = entry.Comment
+		} else {
+			c, err = parseMail(msg, htmlDir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "skipping message: %s\n", err)
+				return nil
+			}
+			idx[msg.Key()] = cacheEntry{ModTime: mtime, Comment: c}
+			changed[c.URL] = true
+		}
+
+		comments[c.URL] = append(comments[c.URL], c)
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := saveCacheIndex(maildirPath, idx); err != nil {
+		return nil, nil, err
+	}
+
+	return comments, changed, nil
+}
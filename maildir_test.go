@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestMessage(t *testing.T, maildirPath, key, body string) {
+	t.Helper()
+
+	path := filepath.Join(maildirPath, "cur", key+":2,")
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatalf("unable to write test message: %s: %s", path, err)
+	}
+}
+
+func TestParseMailsDiffSkipsBadMessages(t *testing.T) {
+	maildirPath := t.TempDir()
+
+	for _, dir := range []string{"tmp", "new", "cur"} {
+		if err := os.Mkdir(filepath.Join(maildirPath, dir), 0755); err != nil {
+			t.Fatalf("unable to create %s: %s", dir, err)
+		}
+	}
+
+	writeTestMessage(t, maildirPath, "bad", "Subject: eggcorn comment\r\n\r\nthis is not JSON")
+
+	writeTestMessage(t, maildirPath, "good", "Subject: eggcorn comment\r\n\r\n"+
+		`{"MessageAttributes":{"Name":{"Value":"Alice"},"Email":{"Value":"alice@example.com"},`+
+		`"Text":{"Value":"hi"},"URL":{"Value":"http://example.com/post1"},`+
+		`"IP":{"Value":"127.0.0.1"},"UserAgent":{"Value":"curl"},`+
+		`"Time":{"Value":"1700000000000"},"ID":{"Value":"msg1"}}}`)
+
+	htmlDir := t.TempDir()
+
+	comments, _, err := parseMailsDiff(maildirPath, htmlDir)
+	if err != nil {
+		t.Fatalf("parseMailsDiff returned an error for a single bad message: %s", err)
+	}
+
+	pageComments := comments["http://example.com/post1"]
+	if len(pageComments) != 1 {
+		t.Fatalf("expected the good message to still be parsed, got %d comments", len(pageComments))
+	}
+	if pageComments[0].ID != "msg1" {
+		t.Fatalf("unexpected comment ID: %s", pageComments[0].ID)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// sanitizePolicy is the allowlist policy comment HTML is run through after
+// being rendered from Markdown. UGCPolicy is meant for exactly this: HTML
+// originating from untrusted, user-generated content.
+var sanitizePolicy = bluemonday.UGCPolicy()
+
+// renderCommentHTML renders a comment's Markdown text to HTML and sanitizes
+// it, so it's safe to emit directly into a template as template.HTML.
+func renderCommentHTML(text string) template.HTML {
+	unsafe := markdown.ToHTML([]byte(text), nil, nil)
+	safe := sanitizePolicy.SanitizeBytes(unsafe)
+	return template.HTML(safe)
+}
+
+// htmlTagRe matches any remaining HTML tag, used to strip sanitized HTML
+// down to plain text.
+var htmlTagRe = regexp.MustCompile(`<[^>]*>`)
+
+// renderCommentPlainText converts a comment's rendered, sanitized HTML back
+// to plain text, in the spirit of html2text. It's used for feed
+// summary/content:text fields, which shouldn't carry markup.
+func renderCommentPlainText(text string) string {
+	safe := string(renderCommentHTML(text))
+	plain := htmlTagRe.ReplaceAllString(safe, "")
+	plain = html.UnescapeString(plain)
+	return strings.TrimSpace(plain)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderCommentHTMLSanitizesScript(t *testing.T) {
+	cases := []string{
+		`<script>alert(1)</script>`,
+		`<img src=x onerror="alert(1)">`,
+		`[click me](javascript:alert(1))`,
+	}
+
+	for _, text := range cases {
+		out := string(renderCommentHTML(text))
+		if strings.Contains(out, "<script") {
+			t.Errorf("renderCommentHTML(%q) leaked a <script> tag: %s", text, out)
+		}
+		if strings.Contains(out, "onerror") {
+			t.Errorf("renderCommentHTML(%q) leaked an onerror attribute: %s", text, out)
+		}
+		if strings.Contains(out, "javascript:") {
+			t.Errorf("renderCommentHTML(%q) leaked a javascript: URL: %s", text, out)
+		}
+	}
+}
+
+func TestRenderCommentHTMLRendersMarkdown(t *testing.T) {
+	out := string(renderCommentHTML("**bold** and *italic*"))
+
+	if !strings.Contains(out, "<strong>bold</strong>") {
+		t.Errorf("expected bold markdown to render, got: %s", out)
+	}
+	if !strings.Contains(out, "<em>italic</em>") {
+		t.Errorf("expected italic markdown to render, got: %s", out)
+	}
+}
+
+func TestRenderCommentPlainText(t *testing.T) {
+	out := renderCommentPlainText("**bold** and <script>alert(1)</script>")
+
+	if strings.Contains(out, "<") {
+		t.Errorf("expected plain text to have no tags left, got: %q", out)
+	}
+	if !strings.Contains(out, "bold") {
+		t.Errorf("expected plain text to retain the markdown content, got: %q", out)
+	}
+	if strings.Contains(out, "alert(1)") {
+		t.Errorf("expected script contents to be stripped, got: %q", out)
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Renderer writes a single page's comments out in some format.
+type Renderer interface {
+	// Render writes comments for rawURL to a file under htmlDir.
+	Render(htmlDir, rawURL string, comments []*Comment) error
+}
+
+// renderersByFormat maps a -format flag value to its Renderer.
+var renderersByFormat = map[string]Renderer{
+	"html": htmlRenderer{},
+	"atom": atomRenderer{},
+	"rss":  rssRenderer{},
+	"json": jsonFeedRenderer{},
+}
+
+// renderersFromFormat parses a comma-separated -format flag value into the
+// Renderers to use.
+func renderersFromFormat(format string) ([]Renderer, error) {
+	var renderers []Renderer
+
+	for _, name := range strings.Split(format, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		r, ok := renderersByFormat[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown format: %s", name)
+		}
+
+		renderers = append(renderers, r)
+	}
+
+	if len(renderers) == 0 {
+		return nil, fmt.Errorf("no formats given")
+	}
+
+	return renderers, nil
+}
+
+// renderPage runs every renderer over a page's comments.
+func renderPage(renderers []Renderer, htmlDir, rawURL string, comments []*Comment) error {
+	for _, r := range renderers {
+		if err := r.Render(htmlDir, rawURL, comments); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pageFilename derives the on-disk filename (without extension) for a page
+// URL: the URL's path with the leading slash stripped.
+func pageFilename(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %s: %s", rawURL, err)
+	}
+
+	if len(u.Path) == 0 || len(u.Path) == 1 {
+		return "", fmt.Errorf("no path found in URL: %s", rawURL)
+	}
+
+	// u.Path should begin with /. Strip that to make the filename.
+	filename := u.Path[1:]
+
+	// There should be no more / characters.
+	if idx := strings.Index(filename, "/"); idx != -1 {
+		return "", fmt.Errorf("unexpected path, too many '/' characters: %s", rawURL)
+	}
+
+	return filename, nil
+}
+
+// htmlRenderer writes comments as the HTML fragment eggcorn-commenter has
+// always produced.
+type htmlRenderer struct{}
+
+func (htmlRenderer) Render(htmlDir, rawURL string, comments []*Comment) error {
+	filename, err := pageFilename(rawURL)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(htmlDir, filename)
+
+	htmlFragment := `
+<h2>Comments</h2>
+{{range .Comments}}
+{{$comment := .}}
+<div class="comment">
+	<div class="comment-name">{{.Name}}</div>
+	<time>{{.Time}}</time>
+	<div class="comment-text">
+		{{renderCommentHTML .Text}}
+	</div>
+	{{if .Attachments}}
+	<div class="comment-attachments">
+		{{range .Attachments}}
+		{{if isImageAttachment .}}
+		<a href="attachments/{{$comment.ID}}/{{.}}"><img src="attachments/{{$comment.ID}}/{{.}}" alt="{{.}}"></a>
+		{{else}}
+		<a href="attachments/{{$comment.ID}}/{{.}}">{{.}}</a>
+		{{end}}
+		{{end}}
+	</div>
+	{{end}}
+</div>
+{{end}}
+`
+
+	funcMap := template.FuncMap{
+		"isImageAttachment": isImageAttachment,
+		"renderCommentHTML": renderCommentHTML,
+	}
+
+	t, err := template.New("comments").Funcs(funcMap).Parse(htmlFragment)
+	if err != nil {
+		return fmt.Errorf("unable to parse template: %s", err)
+	}
+
+	data := struct {
+		Comments []*Comment
+	}{
+		Comments: comments,
+	}
+
+	fh, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := t.Execute(fh, data); err != nil {
+		_ = fh.Close()
+		return fmt.Errorf("unable to execute template: %s", err)
+	}
+
+	if err := fh.Close(); err != nil {
+		return fmt.Errorf("problem closing file: %s", err)
+	}
+
+	fmt.Printf("Wrote %s (%d comments)\n", path, len(comments))
+
+	return nil
+}
+
+// atomFeed is an Atom 1.0 feed document.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title   string     `xml:"title"`
+	ID      string     `xml:"id"`
+	Updated string     `xml:"updated"`
+	Author  atomAuthor `xml:"author"`
+	Content string     `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// atomRenderer writes comments as an Atom 1.0 feed.
+type atomRenderer struct{}
+
+func (atomRenderer) Render(htmlDir, rawURL string, comments []*Comment) error {
+	filename, err := pageFilename(rawURL)
+	if err != nil {
+		return err
+	}
+
+	feed := atomFeed{
+		Xmlns: "http://www.w3.org/2005/Atom",
+		Title: fmt.Sprintf("Comments on %s", rawURL),
+		ID:    rawURL,
+	}
+
+	for _, c := range comments {
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   fmt.Sprintf("Comment from %s", c.Name),
+			ID:      fmt.Sprintf("%s#%s", rawURL, c.ID),
+			Updated: c.Time.Format(time.RFC3339),
+			Author:  atomAuthor{Name: c.Name},
+			Content: renderCommentPlainText(c.Text),
+		})
+
+		if c.Time.Format(time.RFC3339) > feed.Updated {
+			feed.Updated = c.Time.Format(time.RFC3339)
+		}
+	}
+
+	return writeXMLFeed(filepath.Join(htmlDir, filename+".atom"), feed, len(comments))
+}
+
+// rssFeed is an RSS 2.0 feed document.
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Author      string `xml:"author"`
+	PubDate     string `xml:"pubDate"`
+	Description string `xml:"description"`
+	GUID        string `xml:"guid"`
+}
+
+// rssRenderer writes comments as an RSS 2.0 feed.
+type rssRenderer struct{}
+
+func (rssRenderer) Render(htmlDir, rawURL string, comments []*Comment) error {
+	filename, err := pageFilename(rawURL)
+	if err != nil {
+		return err
+	}
+
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       fmt.Sprintf("Comments on %s", rawURL),
+			Link:        rawURL,
+			Description: fmt.Sprintf("Comments on %s", rawURL),
+		},
+	}
+
+	for _, c := range comments {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       fmt.Sprintf("Comment from %s", c.Name),
+			Link:        rawURL,
+			Author:      c.Email,
+			PubDate:     c.Time.Format(time.RFC1123Z),
+			Description: renderCommentPlainText(c.Text),
+			GUID:        fmt.Sprintf("%s#%s", rawURL, c.ID),
+		})
+	}
+
+	return writeXMLFeed(filepath.Join(htmlDir, filename+".rss"), feed, len(comments))
+}
+
+// writeXMLFeed marshals and writes an XML feed document, logging the same
+// way the other renderers do.
+func writeXMLFeed(path string, feed interface{}, numComments int) error {
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode feed: %s", err)
+	}
+
+	out = append([]byte(xml.Header), out...)
+
+	if err := ioutil.WriteFile(path, out, 0644); err != nil {
+		return fmt.Errorf("unable to write: %s: %s", path, err)
+	}
+
+	fmt.Printf("Wrote %s (%d comments)\n", path, numComments)
+
+	return nil
+}
+
+// jsonFeedDocument is a JSON Feed 1.1 document.
+type jsonFeedDocument struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string         `json:"id"`
+	URL           string         `json:"url"`
+	Author        jsonFeedAuthor `json:"author"`
+	ContentText   string         `json:"content_text"`
+	DatePublished string         `json:"date_published"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// jsonFeedRenderer writes comments as a JSON Feed 1.1 document.
+type jsonFeedRenderer struct{}
+
+func (jsonFeedRenderer) Render(htmlDir, rawURL string, comments []*Comment) error {
+	filename, err := pageFilename(rawURL)
+	if err != nil {
+		return err
+	}
+
+	doc := jsonFeedDocument{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       fmt.Sprintf("Comments on %s", rawURL),
+		HomePageURL: rawURL,
+	}
+
+	for _, c := range comments {
+		doc.Items = append(doc.Items, jsonFeedItem{
+			ID:            fmt.Sprintf("%s#%s", rawURL, c.ID),
+			URL:           rawURL,
+			Author:        jsonFeedAuthor{Name: c.Name},
+			ContentText:   renderCommentPlainText(c.Text),
+			DatePublished: c.Time.Format(time.RFC3339),
+		})
+	}
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode feed: %s", err)
+	}
+
+	path := filepath.Join(htmlDir, filename+".json")
+
+	if err := ioutil.WriteFile(path, out, 0644); err != nil {
+		return fmt.Errorf("unable to write: %s: %s", path, err)
+	}
+
+	fmt.Printf("Wrote %s (%d comments)\n", path, len(comments))
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPageFilename(t *testing.T) {
+	cases := []struct {
+		rawURL   string
+		filename string
+		wantErr  bool
+	}{
+		{"http://example.com/post1", "post1", false},
+		{"http://example.com/", "", true},
+		{"http://example.com", "", true},
+		{"http://example.com/a/b", "", true},
+		{"http://example.com/%zz", "", true},
+	}
+
+	for _, c := range cases {
+		filename, err := pageFilename(c.rawURL)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("pageFilename(%q) = %q, nil; want an error", c.rawURL, filename)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("pageFilename(%q) returned an error: %s", c.rawURL, err)
+			continue
+		}
+		if filename != c.filename {
+			t.Errorf("pageFilename(%q) = %q, want %q", c.rawURL, filename, c.filename)
+		}
+	}
+}
+
+func testComment() *Comment {
+	return &Comment{
+		Name:      "Alice",
+		Email:     "alice@example.com",
+		Text:      "hello there",
+		URL:       "http://example.com/post1",
+		IP:        net.ParseIP("127.0.0.1"),
+		UserAgent: "curl",
+		Time:      time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		ID:        "msg1",
+	}
+}
+
+func TestHTMLRendererRender(t *testing.T) {
+	htmlDir := t.TempDir()
+	c := testComment()
+
+	if err := (htmlRenderer{}).Render(htmlDir, c.URL, []*Comment{c}); err != nil {
+		t.Fatalf("Render returned an error: %s", err)
+	}
+
+	out, err := ioutil.ReadFile(filepath.Join(htmlDir, "post1"))
+	if err != nil {
+		t.Fatalf("unable to read rendered file: %s", err)
+	}
+
+	if !strings.Contains(string(out), "Alice") {
+		t.Errorf("rendered HTML missing comment name: %s", out)
+	}
+	if !strings.Contains(string(out), "hello there") {
+		t.Errorf("rendered HTML missing comment text: %s", out)
+	}
+}
+
+func TestAtomRendererRender(t *testing.T) {
+	htmlDir := t.TempDir()
+	c := testComment()
+
+	if err := (atomRenderer{}).Render(htmlDir, c.URL, []*Comment{c}); err != nil {
+		t.Fatalf("Render returned an error: %s", err)
+	}
+
+	out, err := ioutil.ReadFile(filepath.Join(htmlDir, "post1.atom"))
+	if err != nil {
+		t.Fatalf("unable to read rendered file: %s", err)
+	}
+
+	var feed atomFeed
+	if err := xml.Unmarshal(out, &feed); err != nil {
+		t.Fatalf("unable to parse rendered Atom feed: %s", err)
+	}
+
+	if len(feed.Entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(feed.Entries))
+	}
+	if feed.Entries[0].Author.Name != "Alice" {
+		t.Errorf("unexpected author: %s", feed.Entries[0].Author.Name)
+	}
+	if feed.Entries[0].Content != "hello there" {
+		t.Errorf("unexpected content: %s", feed.Entries[0].Content)
+	}
+}
+
+func TestRSSRendererRender(t *testing.T) {
+	htmlDir := t.TempDir()
+	c := testComment()
+
+	if err := (rssRenderer{}).Render(htmlDir, c.URL, []*Comment{c}); err != nil {
+		t.Fatalf("Render returned an error: %s", err)
+	}
+
+	out, err := ioutil.ReadFile(filepath.Join(htmlDir, "post1.rss"))
+	if err != nil {
+		t.Fatalf("unable to read rendered file: %s", err)
+	}
+
+	var feed rssFeed
+	if err := xml.Unmarshal(out, &feed); err != nil {
+		t.Fatalf("unable to parse rendered RSS feed: %s", err)
+	}
+
+	if len(feed.Channel.Items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(feed.Channel.Items))
+	}
+	if feed.Channel.Items[0].Author != "alice@example.com" {
+		t.Errorf("unexpected author: %s", feed.Channel.Items[0].Author)
+	}
+	if feed.Channel.Items[0].Description != "hello there" {
+		t.Errorf("unexpected description: %s", feed.Channel.Items[0].Description)
+	}
+}
+
+func TestJSONFeedRendererRender(t *testing.T) {
+	htmlDir := t.TempDir()
+	c := testComment()
+
+	if err := (jsonFeedRenderer{}).Render(htmlDir, c.URL, []*Comment{c}); err != nil {
+		t.Fatalf("Render returned an error: %s", err)
+	}
+
+	out, err := ioutil.ReadFile(filepath.Join(htmlDir, "post1.json"))
+	if err != nil {
+		t.Fatalf("unable to read rendered file: %s", err)
+	}
+
+	var doc jsonFeedDocument
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("unable to parse rendered JSON feed: %s", err)
+	}
+
+	if len(doc.Items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(doc.Items))
+	}
+	if doc.Items[0].Author.Name != "Alice" {
+		t.Errorf("unexpected author: %s", doc.Items[0].Author.Name)
+	}
+	if doc.Items[0].ContentText != "hello there" {
+		t.Errorf("unexpected content_text: %s", doc.Items[0].ContentText)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// runWatch watches a Maildir's new directory and regenerates only the
+// affected pages as messages arrive, so eggcorn-commenter can run as a
+// long-lived daemon instead of a batch job.
+func runWatch(args *Args) error {
+	renderers, err := renderersFromFormat(args.Format)
+	if err != nil {
+		return err
+	}
+
+	// Process whatever is already waiting before we start watching, the same
+	// way a batch run would.
+	if err := processMaildirChanges(args, renderers); err != nil {
+		return err
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("unable to create watcher: %s", err)
+	}
+	defer func() { _ = w.Close() }()
+
+	newDir := filepath.Join(args.Maildir, "new")
+	if err := w.Add(newDir); err != nil {
+		return fmt.Errorf("unable to watch: %s: %s", newDir, err)
+	}
+
+	fmt.Printf("Watching %s\n", newDir)
+
+	for {
+		select {
+		case event, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+
+			if err := processMaildirChanges(args, renderers); err != nil {
+				fmt.Fprintf(os.Stderr, "unable to process new messages: %s\n", err)
+			}
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "watcher error: %s\n", err)
+		}
+	}
+}
+
+// processMaildirChanges reparses the Maildir (cheaply, thanks to the cache
+// index) and regenerates the pages that got a new or changed comment.
+//
+// It holds regenMu for its duration, as regeneratePage does. main runs either
+// -listen or -watch, never both, so a -listen server working on the same
+// Maildir is a separate process and is not serialized against by regenMu.
+//
+// A page that fails to render (e.g. a URL that fails pageFilename's checks)
+// is logged and skipped rather than aborting the batch: the comment that
+// caused it is already cached as parsed and won't be retried on a later
+// pass, so bailing out here would also silently suppress regeneration of
+// every other, unrelated page that changed in the same batch.
+func processMaildirChanges(args *Args, renderers []Renderer) error {
+	regenMu.Lock()
+	defer regenMu.Unlock()
+
+	comments, changed, err := parseMailsDiff(args.Maildir, args.HTMLDir)
+	if err != nil {
+		return err
+	}
+
+	for rawURL := range changed {
+		pageComments := comments[rawURL]
+		sort.Sort(ByTime(pageComments))
+
+		if err := renderPage(renderers, args.HTMLDir, rawURL, pageComments); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to render page: %s: %s\n", rawURL, err)
+			continue
+		}
+	}
+
+	return nil
+}